@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/performance"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// Checker is one --command implementation. Adding a new check type means
+// writing a Checker and registering it in the checkers map below, rather
+// than editing main's retrieval switch. Every Checker is either a
+// ResourceChecker or a SingleObjectChecker.
+type Checker interface {
+	// ObjectType is the vSphere managed object type this check lists
+	// through a container view, e.g. "HostSystem" or "Datastore".
+	ObjectType() string
+}
+
+// ResourceChecker retrieves every object of its type and expresses each as
+// a free-percentage CheckResult, so main can filter by name/--match/
+// --exclude and evaluate or aggregate the survivors.
+type ResourceChecker interface {
+	Checker
+	Resources(ctx context.Context, c *govmomi.Client, v *view.ContainerView) ([]CheckResult, error)
+}
+
+// SingleObjectChecker evaluates exactly one named object directly, for
+// checks whose result isn't expressible as a free-percentage CheckResult
+// (snapshot age, IOPS counters, NIC link state, ...).
+type SingleObjectChecker interface {
+	Checker
+	Run(ctx context.Context, c *govmomi.Client, v *view.ContainerView, name string, warn, crit int) (status int, msg string, err error)
+}
+
+// checkers is the registry of --command choices.
+var checkers = map[string]Checker{
+	"CPU":         hostCPUChecker{},
+	"MEM":         hostMemChecker{},
+	"VMFS":        datastoreChecker{},
+	"VM":          vmChecker{},
+	"VM_SNAPSHOT": vmSnapshotChecker{},
+	"DS_IOPS":     dsIOPSChecker{},
+	"CLUSTER":     clusterChecker{},
+	"NET":         netChecker{},
+}
+
+type hostCPUChecker struct{}
+
+func (hostCPUChecker) ObjectType() string { return "HostSystem" }
+
+func (hostCPUChecker) Resources(ctx context.Context, c *govmomi.Client, v *view.ContainerView) ([]CheckResult, error) {
+	var hss []mo.HostSystem
+	if err := v.Retrieve(ctx, []string{"HostSystem"}, []string{"name", "summary"}, &hss); err != nil {
+		return nil, err
+	}
+
+	results := make([]CheckResult, 0, len(hss))
+	for _, host := range hss {
+		e := cpuStats(host)
+		results = append(results, CheckResult{Command: "CPU", Name: e.name, Total: e.total, Free: e.free, Unit: resultUnit("CPU")})
+	}
+	return results, nil
+}
+
+type hostMemChecker struct{}
+
+func (hostMemChecker) ObjectType() string { return "HostSystem" }
+
+func (hostMemChecker) Resources(ctx context.Context, c *govmomi.Client, v *view.ContainerView) ([]CheckResult, error) {
+	var hss []mo.HostSystem
+	if err := v.Retrieve(ctx, []string{"HostSystem"}, []string{"name", "summary"}, &hss); err != nil {
+		return nil, err
+	}
+
+	results := make([]CheckResult, 0, len(hss))
+	for _, host := range hss {
+		e := memStats(host)
+		results = append(results, CheckResult{Command: "MEM", Name: e.name, Total: e.total, Free: e.free, Unit: resultUnit("MEM")})
+	}
+	return results, nil
+}
+
+type datastoreChecker struct{}
+
+func (datastoreChecker) ObjectType() string { return "Datastore" }
+
+func (datastoreChecker) Resources(ctx context.Context, c *govmomi.Client, v *view.ContainerView) ([]CheckResult, error) {
+	var dss []mo.Datastore
+	if err := v.Retrieve(ctx, []string{"Datastore"}, []string{"name", "summary"}, &dss); err != nil {
+		return nil, err
+	}
+
+	results := make([]CheckResult, 0, len(dss))
+	for _, ds := range dss {
+		e := datastoreStats(ds)
+		results = append(results, CheckResult{Command: "VMFS", Name: e.name, Total: e.total, Free: e.free, Unit: resultUnit("VMFS")})
+	}
+	return results, nil
+}
+
+func datastoreStats(ds mo.Datastore) *resource {
+	return &resource{
+		name: ds.Summary.Name,
+		statistics: statistics{
+			total: float64(ds.Summary.Capacity),
+			free:  float64(ds.Summary.FreeSpace),
+		},
+	}
+}
+
+func cpuStats(host mo.HostSystem) *resource {
+	return &resource{
+		name: host.Name,
+		statistics: statistics{
+			total: float64(host.Summary.Hardware.CpuMhz) * float64(host.Summary.Hardware.NumCpuCores),
+			free:  (float64(host.Summary.Hardware.CpuMhz) * float64(host.Summary.Hardware.NumCpuCores)) - float64(host.Summary.QuickStats.OverallCpuUsage),
+		},
+	}
+}
+
+func memStats(host mo.HostSystem) *resource {
+	return &resource{
+		name: host.Name,
+		statistics: statistics{
+			total: float64(host.Summary.Hardware.MemorySize) / 1024 / 1024,
+			free:  (float64(host.Summary.Hardware.MemorySize) / 1024 / 1024) - float64(host.Summary.QuickStats.OverallMemoryUsage),
+		},
+	}
+}
+
+// vmChecker reports every powered-on VM's memory headroom, along with its
+// power state and uptime as a detail note. VMs that aren't powered on are
+// left out of the free% evaluation entirely, since "stopped" isn't a
+// memory reading.
+type vmChecker struct{}
+
+func (vmChecker) ObjectType() string { return "VirtualMachine" }
+
+func (vmChecker) Resources(ctx context.Context, c *govmomi.Client, v *view.ContainerView) ([]CheckResult, error) {
+	var vms []mo.VirtualMachine
+	if err := v.Retrieve(ctx, []string{"VirtualMachine"}, []string{"name", "summary", "runtime"}, &vms); err != nil {
+		return nil, err
+	}
+
+	results := make([]CheckResult, 0, len(vms))
+	for _, vm := range vms {
+		powerState := string(vm.Runtime.PowerState)
+		if powerState != string(types.VirtualMachinePowerStatePoweredOn) {
+			// Power state is its own signal, not a memory reading: most
+			// vCenters have templates and intentionally-stopped VMs, so
+			// folding "not running" into free% would make a fleet-wide
+			// `--command VM` permanently CRITICAL. Leave these out of the
+			// memory check; a dedicated power-state check can watch them.
+			debugf("%s skipped, power=%s\n", vm.Name, powerState)
+			continue
+		}
+
+		memTotal := float64(vm.Summary.Config.MemorySizeMB)
+		memUsed := float64(vm.Summary.QuickStats.GuestMemoryUsage)
+
+		detail := fmt.Sprintf("(power=%s", powerState)
+		if vm.Runtime.BootTime != nil {
+			detail += fmt.Sprintf(", uptime=%s", time.Since(*vm.Runtime.BootTime).Round(time.Minute))
+		}
+		detail += ")"
+
+		results = append(results, CheckResult{
+			Command: "VM",
+			Name:    vm.Name,
+			Total:   memTotal,
+			Free:    memTotal - memUsed,
+			Unit:    "MB",
+			Detail:  detail,
+		})
+	}
+	return results, nil
+}
+
+// vmSnapshotChecker warns when a VM's oldest snapshot has been sitting
+// around longer than warn (or crit) days. Unlike the free-percentage
+// checks, warn/crit here are upper bounds on age, not lower bounds on
+// free space, so it stays a SingleObjectChecker rather than a
+// ResourceChecker.
+type vmSnapshotChecker struct{}
+
+func (vmSnapshotChecker) ObjectType() string { return "VirtualMachine" }
+
+func (vmSnapshotChecker) Run(ctx context.Context, c *govmomi.Client, v *view.ContainerView, name string, warn, crit int) (int, string, error) {
+	var vms []mo.VirtualMachine
+	if err := v.Retrieve(ctx, []string{"VirtualMachine"}, []string{"name", "snapshot"}, &vms); err != nil {
+		return 0, "", err
+	}
+
+	for _, vm := range vms {
+		debugf("%s\n", vm.Name)
+		if vm.Name != name {
+			continue
+		}
+
+		if vm.Snapshot == nil || len(vm.Snapshot.RootSnapshotList) == 0 {
+			return statusOK, statusLine("VM_SNAPSHOT", statusOK, fmt.Sprintf("%s has no snapshots", vm.Name), ""), nil
+		}
+
+		oldest := oldestSnapshotAge(vm.Snapshot.RootSnapshotList)
+		ageDays := oldest.Hours() / 24
+		status := statusForUpperBound(ageDays, warn, crit)
+
+		summary := fmt.Sprintf("%s oldest snapshot is %.1f days old", vm.Name, ageDays)
+		perfdata := fmt.Sprintf("'age_days'=%.1f;%d;%d;0;", ageDays, warn, crit)
+		return status, statusLine("VM_SNAPSHOT", status, summary, perfdata), nil
+	}
+
+	return statusUnknown, fmt.Sprintf("VM_SNAPSHOT UNKNOWN - no virtual machine named %q found", name), nil
+}
+
+// oldestSnapshotAge walks the snapshot tree and returns the age of its
+// oldest node.
+func oldestSnapshotAge(tree []types.VirtualMachineSnapshotTree) time.Duration {
+	var oldest time.Time
+	var walk func([]types.VirtualMachineSnapshotTree)
+	walk = func(nodes []types.VirtualMachineSnapshotTree) {
+		for _, n := range nodes {
+			if oldest.IsZero() || n.CreateTime.Before(oldest) {
+				oldest = n.CreateTime
+			}
+			walk(n.ChildSnapshotList)
+		}
+	}
+	walk(tree)
+	return time.Since(oldest)
+}
+
+// statusForUpperBound classifies value against warn/crit when both are
+// upper bounds (alert once value rises to or above them), the inverse of
+// CheckResult.Status's free-percentage lower-bound comparison. Used by
+// checks like VM_SNAPSHOT (age in days) and DS_IOPS (IOPS) whose warn/crit
+// mean "too much", not "not enough free space".
+func statusForUpperBound(value float64, warn, crit int) int {
+	switch {
+	case value >= float64(crit):
+		return statusCritical
+	case value >= float64(warn):
+		return statusWarning
+	default:
+		return statusOK
+	}
+}
+
+// dsIOPSChecker reports a datastore's current read+write IOPS via the
+// PerformanceManager, warning/critical acting as upper bounds.
+type dsIOPSChecker struct{}
+
+func (dsIOPSChecker) ObjectType() string { return "Datastore" }
+
+func (dsIOPSChecker) Run(ctx context.Context, c *govmomi.Client, v *view.ContainerView, name string, warn, crit int) (int, string, error) {
+	var dss []mo.Datastore
+	if err := v.Retrieve(ctx, []string{"Datastore"}, []string{"name"}, &dss); err != nil {
+		return 0, "", err
+	}
+
+	for _, ds := range dss {
+		debugf("%s\n", ds.Name)
+		if ds.Name != name {
+			continue
+		}
+
+		pm := performance.NewManager(c.Client)
+		metrics := []string{"datastore.numberReadAveraged.average", "datastore.numberWriteAveraged.average"}
+		samples, err := pm.SampleByName(ctx, types.PerfQuerySpec{MaxSample: 1}, metrics, []types.ManagedObjectReference{ds.Self})
+		if err != nil {
+			return 0, "", err
+		}
+
+		series, err := pm.ToMetricSeries(ctx, samples)
+		if err != nil {
+			return 0, "", err
+		}
+
+		iops := sumLatestIOPS(series)
+		status := statusForUpperBound(float64(iops), warn, crit)
+
+		summary := fmt.Sprintf("%s is doing %d IOPS", ds.Name, iops)
+		perfdata := fmt.Sprintf("'iops'=%d;%d;%d;0;", iops, warn, crit)
+		return status, statusLine("DS_IOPS", status, summary, perfdata), nil
+	}
+
+	return statusUnknown, fmt.Sprintf("DS_IOPS UNKNOWN - no datastore named %q found", name), nil
+}
+
+// sumLatestIOPS adds up the most recent sample of every metric series
+// (read and write IOPS) across every queried entity.
+func sumLatestIOPS(series []performance.EntityMetric) int64 {
+	var iops int64
+	for _, entity := range series {
+		for _, s := range entity.Value {
+			if len(s.Value) > 0 {
+				iops += s.Value[len(s.Value)-1]
+			}
+		}
+	}
+	return iops
+}
+
+// clusterChecker reports every cluster's actual memory headroom, summed
+// from its member hosts' current usage, with effective capacity and
+// DRS/HA enablement noted as a detail. EffectiveMemory (vSphere's
+// capacity-after-overhead figure) doesn't move as VMs consume memory, so
+// it's informational only rather than the threshold-evaluated figure.
+type clusterChecker struct{}
+
+func (clusterChecker) ObjectType() string { return "ClusterComputeResource" }
+
+func (clusterChecker) Resources(ctx context.Context, c *govmomi.Client, v *view.ContainerView) ([]CheckResult, error) {
+	var clusters []mo.ClusterComputeResource
+	if err := v.Retrieve(ctx, []string{"ClusterComputeResource"}, []string{"name", "summary", "configuration", "host"}, &clusters); err != nil {
+		return nil, err
+	}
+
+	results := make([]CheckResult, 0, len(clusters))
+	for _, cl := range clusters {
+		summary, ok := cl.Summary.(*types.ClusterComputeResourceSummary)
+		if !ok {
+			// Total left at 0 so this surfaces as UNKNOWN rather than
+			// being silently dropped from the results.
+			results = append(results, CheckResult{Command: "CLUSTER", Name: cl.Name})
+			continue
+		}
+
+		drsEnabled, haEnabled := clusterFlags(cl.Configuration)
+
+		total, free, err := clusterHostMemory(ctx, c, cl.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, CheckResult{
+			Command: "CLUSTER",
+			Name:    cl.Name,
+			Total:   total,
+			Free:    free,
+			Unit:    "MB",
+			Detail:  fmt.Sprintf("(drs=%t, ha=%t, effectiveCpu=%dMHz, effectiveMemory=%dMB)", drsEnabled, haEnabled, summary.EffectiveCpu, summary.EffectiveMemory),
+		})
+	}
+	return results, nil
+}
+
+// clusterHostMemory sums the memory total/free of a cluster's member
+// hosts, the same figures CPU/MEM report per-host, so the cluster check
+// reflects real usage pressure instead of a static capacity figure.
+func clusterHostMemory(ctx context.Context, c *govmomi.Client, hostRefs []types.ManagedObjectReference) (total, free float64, err error) {
+	if len(hostRefs) == 0 {
+		return 0, 0, nil
+	}
+
+	var hss []mo.HostSystem
+	if err := property.DefaultCollector(c.Client).Retrieve(ctx, hostRefs, []string{"name", "summary"}, &hss); err != nil {
+		return 0, 0, err
+	}
+
+	for _, host := range hss {
+		e := memStats(host)
+		total += e.total
+		free += e.free
+	}
+	return total, free, nil
+}
+
+// clusterFlags reports whether DRS and HA are enabled from a cluster's
+// configuration, treating an absent Enabled pointer as disabled.
+func clusterFlags(cfg types.ClusterConfigInfo) (drs, ha bool) {
+	drs = cfg.DrsConfig.Enabled != nil && *cfg.DrsConfig.Enabled
+	ha = cfg.DasConfig.Enabled != nil && *cfg.DasConfig.Enabled
+	return drs, ha
+}
+
+// netChecker warns when a host has any physical NIC without an active
+// link.
+type netChecker struct{}
+
+func (netChecker) ObjectType() string { return "HostSystem" }
+
+func (netChecker) Run(ctx context.Context, c *govmomi.Client, v *view.ContainerView, name string, warn, crit int) (int, string, error) {
+	var hss []mo.HostSystem
+	if err := v.Retrieve(ctx, []string{"HostSystem"}, []string{"name", "config"}, &hss); err != nil {
+		return 0, "", err
+	}
+
+	for _, host := range hss {
+		debugf("%s\n", host.Name)
+		if host.Name != name {
+			continue
+		}
+
+		if host.Config == nil {
+			return statusUnknown, fmt.Sprintf("NET UNKNOWN - %s has no config data", host.Name), nil
+		}
+
+		down := downNics(host.Config.Network.Pnic)
+
+		if len(down) > 0 {
+			summary := fmt.Sprintf("%s has %d NIC(s) down: %v", host.Name, len(down), down)
+			return statusCritical, statusLine("NET", statusCritical, summary, ""), nil
+		}
+
+		summary := fmt.Sprintf("%s all %d NIC(s) up", host.Name, len(host.Config.Network.Pnic))
+		return statusOK, statusLine("NET", statusOK, summary, ""), nil
+	}
+
+	return statusUnknown, fmt.Sprintf("NET UNKNOWN - no host named %q found", name), nil
+}
+
+// downNics returns the device names of every physical NIC with no active
+// link (a nil LinkSpeed).
+func downNics(pnics []types.PhysicalNic) []string {
+	var down []string
+	for _, pnic := range pnics {
+		if pnic.LinkSpeed == nil {
+			down = append(down, pnic.Device)
+		}
+	}
+	return down
+}
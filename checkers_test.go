@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/performance"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestOldestSnapshotAge(t *testing.T) {
+	now := time.Now()
+	tree := []types.VirtualMachineSnapshotTree{
+		{
+			CreateTime: now.Add(-48 * time.Hour),
+			ChildSnapshotList: []types.VirtualMachineSnapshotTree{
+				{CreateTime: now.Add(-72 * time.Hour)},
+			},
+		},
+		{CreateTime: now.Add(-1 * time.Hour)},
+	}
+
+	got := oldestSnapshotAge(tree).Round(time.Hour)
+	want := 72 * time.Hour
+	if got != want {
+		t.Errorf("oldestSnapshotAge() = %v, want %v", got, want)
+	}
+}
+
+func TestStatusForUpperBound(t *testing.T) {
+	cases := []struct {
+		name  string
+		value float64
+		want  int
+	}{
+		{name: "below warning is OK", value: 5, want: statusOK},
+		{name: "at warning threshold", value: 15, want: statusWarning},
+		{name: "at critical threshold", value: 20, want: statusCritical},
+		{name: "above critical", value: 100, want: statusCritical},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := statusForUpperBound(c.value, 15, 20); got != c.want {
+				t.Errorf("statusForUpperBound(%v, 15, 20) = %d, want %d", c.value, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSumLatestIOPS(t *testing.T) {
+	series := []performance.EntityMetric{
+		{Value: []performance.MetricSeries{
+			{Name: "datastore.numberReadAveraged.average", Value: []int64{10, 20, 30}},
+			{Name: "datastore.numberWriteAveraged.average", Value: []int64{1, 2, 3}},
+		}},
+		{Value: []performance.MetricSeries{
+			{Name: "datastore.numberReadAveraged.average", Value: nil},
+		}},
+	}
+
+	got := sumLatestIOPS(series)
+	want := int64(33) // latest read (30) + latest write (3), empty series ignored
+	if got != want {
+		t.Errorf("sumLatestIOPS() = %d, want %d", got, want)
+	}
+}
+
+func TestClusterFlags(t *testing.T) {
+	enabled, disabled := true, false
+
+	cases := []struct {
+		name    string
+		cfg     types.ClusterConfigInfo
+		wantDrs bool
+		wantHa  bool
+	}{
+		{
+			name:    "both enabled",
+			cfg:     types.ClusterConfigInfo{DrsConfig: types.ClusterDrsConfigInfo{Enabled: &enabled}, DasConfig: types.ClusterDasConfigInfo{Enabled: &enabled}},
+			wantDrs: true,
+			wantHa:  true,
+		},
+		{
+			name:    "both disabled",
+			cfg:     types.ClusterConfigInfo{DrsConfig: types.ClusterDrsConfigInfo{Enabled: &disabled}, DasConfig: types.ClusterDasConfigInfo{Enabled: &disabled}},
+			wantDrs: false,
+			wantHa:  false,
+		},
+		{
+			name:    "nil pointers treated as disabled",
+			cfg:     types.ClusterConfigInfo{},
+			wantDrs: false,
+			wantHa:  false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			drs, ha := clusterFlags(c.cfg)
+			if drs != c.wantDrs || ha != c.wantHa {
+				t.Errorf("clusterFlags() = (%t, %t), want (%t, %t)", drs, ha, c.wantDrs, c.wantHa)
+			}
+		})
+	}
+}
+
+func TestDownNics(t *testing.T) {
+	up := &types.PhysicalNicLinkInfo{}
+
+	pnics := []types.PhysicalNic{
+		{Device: "vmnic0", LinkSpeed: up},
+		{Device: "vmnic1", LinkSpeed: nil},
+		{Device: "vmnic2", LinkSpeed: nil},
+	}
+
+	got := downNics(pnics)
+	want := []string{"vmnic1", "vmnic2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("downNics() = %v, want %v", got, want)
+	}
+}
+
+func TestDownNicsAllUp(t *testing.T) {
+	up := &types.PhysicalNicLinkInfo{}
+	pnics := []types.PhysicalNic{{Device: "vmnic0", LinkSpeed: up}}
+
+	if got := downNics(pnics); got != nil {
+		t.Errorf("downNics() = %v, want nil", got)
+	}
+}
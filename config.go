@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configPath   string
+	target       string
+	passwordFile string
+)
+
+// TargetConfig is one named entry under "targets:" in the config file: a
+// hostname/credential pair plus the default thresholds to check it with.
+type TargetConfig struct {
+	Hostname     string `yaml:"hostname"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+	Warning      int    `yaml:"warning"`
+	Critical     int    `yaml:"critical"`
+}
+
+// Config is the shape of the file passed via --config.
+type Config struct {
+	Targets map[string]TargetConfig `yaml:"targets"`
+}
+
+func init() {
+	pflag.StringVar(&configPath, "config", "", "Path to a YAML config file defining named --target entries")
+	pflag.StringVar(&target, "target", "", "Named target to load from the --config file")
+	pflag.StringVar(&passwordFile, "password-file", "", "Read the password from this file instead of --password")
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	return &cfg, nil
+}
+
+// applyLayeredConfig resolves hostname/username/password/passwordFile/
+// warning/critical from, in increasing order of precedence: the --config
+// file's --target entry, the GOVC_* environment variables, and the CLI
+// flags that were actually passed. It must run after pflag.Parse().
+func applyLayeredConfig() error {
+	var fileTarget TargetConfig
+	if configPath != "" {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		if target != "" {
+			t, ok := cfg.Targets[target]
+			if !ok {
+				return fmt.Errorf("no target named %q in %s", target, configPath)
+			}
+			fileTarget = t
+		}
+	}
+
+	hostname = layeredString(pflag.Lookup("hostname"), hostname, os.Getenv("GOVC_URL"), fileTarget.Hostname)
+	username = layeredString(pflag.Lookup("username"), username, os.Getenv("GOVC_USERNAME"), fileTarget.Username)
+	password = layeredString(pflag.Lookup("password"), password, os.Getenv("GOVC_PASSWORD"), fileTarget.Password)
+	passwordFile = layeredString(pflag.Lookup("password-file"), passwordFile, os.Getenv("GOVC_PASSWORD_FILE"), fileTarget.PasswordFile)
+	warning = layeredInt(pflag.Lookup("warning"), warning, fileTarget.Warning)
+	critical = layeredInt(pflag.Lookup("critical"), critical, fileTarget.Critical)
+
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return fmt.Errorf("reading password file: %w", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return nil
+}
+
+// layeredString returns flagVal if the flag was explicitly passed on the
+// command line, else envVal if set, else configVal.
+func layeredString(flag *pflag.Flag, flagVal, envVal, configVal string) string {
+	if flag != nil && flag.Changed {
+		return flagVal
+	}
+	if envVal != "" {
+		return envVal
+	}
+	if configVal != "" {
+		return configVal
+	}
+	return flagVal
+}
+
+// layeredInt returns flagVal if the flag was explicitly passed on the
+// command line, else configVal if it was set, else flagVal (the default).
+func layeredInt(flag *pflag.Flag, flagVal, configVal int) int {
+	if flag != nil && flag.Changed {
+		return flagVal
+	}
+	if configVal != 0 {
+		return configVal
+	}
+	return flagVal
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyLayeredConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(`
+targets:
+  prod:
+    hostname: prod.example.com
+    username: config-user
+    password: config-pass
+    warning: 20
+    critical: 5
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GOVC_USERNAME", "env-user")
+
+	origHostname, origUsername, origPassword, origWarning, origCritical := hostname, username, password, warning, critical
+	origConfigPath, origTarget := configPath, target
+	t.Cleanup(func() {
+		hostname, username, password, warning, critical = origHostname, origUsername, origPassword, origWarning, origCritical
+		configPath, target = origConfigPath, origTarget
+	})
+
+	hostname, username, password, warning, critical = "", "", "", 15, 10
+	configPath, target = cfgPath, "prod"
+
+	if err := applyLayeredConfig(); err != nil {
+		t.Fatalf("applyLayeredConfig() error = %v", err)
+	}
+
+	if hostname != "prod.example.com" {
+		t.Errorf("hostname = %q, want config value", hostname)
+	}
+	if username != "env-user" {
+		t.Errorf("username = %q, want env var to win over config", username)
+	}
+	if password != "config-pass" {
+		t.Errorf("password = %q, want config value", password)
+	}
+	if warning != 20 || critical != 5 {
+		t.Errorf("warning/critical = %d/%d, want 20/5 from config", warning, critical)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// sample is one labeled observation, cached between scrapes.
+type sample struct {
+	metric string
+	labels string // pre-rendered, e.g. `host="esx1",cluster="prod"`
+	value  float64
+}
+
+func (s sample) key() string {
+	return s.metric + "{" + s.labels + "}"
+}
+
+// metricCache holds the most recently polled samples, keyed by metric+labels,
+// so that HTTP scrapes never block on a live vCenter round-trip.
+type metricCache struct {
+	samples sync.Map // string -> sample
+}
+
+func (c *metricCache) set(s sample) {
+	c.samples.Store(s.key(), s)
+}
+
+// WriteTo renders the cache in Prometheus text exposition format.
+func (c *metricCache) WriteTo(w http.ResponseWriter) {
+	byMetric := map[string][]sample{}
+	c.samples.Range(func(_, v interface{}) bool {
+		s := v.(sample)
+		byMetric[s.metric] = append(byMetric[s.metric], s)
+		return true
+	})
+
+	names := make([]string, 0, len(byMetric))
+	for name := range byMetric {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		samples := byMetric[name]
+		sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+		for _, s := range samples {
+			fmt.Fprintf(w, "%s{%s} %v\n", s.metric, s.labels, s.value)
+		}
+	}
+}
+
+func labels(pairs ...string) string {
+	if len(pairs)%2 != 0 {
+		panic("labels: odd number of arguments")
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", pairs[i], pairs[i+1]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// exporterSession wraps a govmomi client and re-logs in when vCenter
+// reports that the session has expired, so the daemon survives a vCenter
+// restart without needing to be restarted itself.
+type exporterSession struct {
+	url *url.URL
+	c   *govmomi.Client
+}
+
+func newExporterSession(ctx context.Context, u *url.URL) (*exporterSession, error) {
+	c, err := govmomi.NewClient(ctx, u, true)
+	if err != nil {
+		return nil, err
+	}
+	return &exporterSession{url: u, c: c}, nil
+}
+
+func isNotAuthenticated(err error) bool {
+	if !soap.IsSoapFault(err) {
+		return false
+	}
+	_, ok := soap.ToVimFault(err).(*types.NotAuthenticated)
+	return ok
+}
+
+// relogin re-establishes the govmomi session using the credentials
+// embedded in the session's URL.
+func (s *exporterSession) relogin(ctx context.Context) error {
+	c, err := govmomi.NewClient(ctx, s.url, true)
+	if err != nil {
+		return err
+	}
+	s.c = c
+	return nil
+}
+
+func runExporter(args []string) {
+	flags := pflag.NewFlagSet("exporter", pflag.ExitOnError)
+	flags.StringVarP(&hostname, "hostname", "h", "", "ESXi/vCenter hostname to query")
+	flags.StringVarP(&username, "username", "u", "", "Username to connect with.")
+	flags.StringVarP(&password, "password", "p", "", "Password to use with the username.")
+	flags.StringVar(&passwordFile, "password-file", "", "Read the password from this file instead of --password")
+	listen := flags.String("listen", ":9290", "Address to serve /metrics on")
+	interval := flags.Duration("interval", 30*time.Second, "Scrape interval for polling vCenter")
+	flags.Parse(args)
+
+	if *interval <= 0 {
+		log.Fatalf("--interval must be positive, got %s", *interval)
+	}
+
+	hostname = layeredString(flags.Lookup("hostname"), hostname, os.Getenv("GOVC_URL"), "")
+	username = layeredString(flags.Lookup("username"), username, os.Getenv("GOVC_USERNAME"), "")
+	password = layeredString(flags.Lookup("password"), password, os.Getenv("GOVC_PASSWORD"), "")
+	passwordFile = layeredString(flags.Lookup("password-file"), passwordFile, os.Getenv("GOVC_PASSWORD_FILE"), "")
+
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			log.Fatalf("reading password file: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if hostname == "" || username == "" || password == "" {
+		log.Fatal("exporter requires --hostname, --username and --password (or the GOVC_URL/GOVC_USERNAME/GOVC_PASSWORD env vars)")
+	}
+
+	ctx := context.Background()
+	u, _ := url.Parse(urlCheck(hostname))
+	u.User = url.UserPassword(username, password)
+
+	sess, err := newExporterSession(ctx, u)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cache := &metricCache{}
+
+	poll := func() {
+		if err := pollOnce(ctx, sess, cache); err != nil {
+			if isNotAuthenticated(err) {
+				debugf("session expired, logging back in\n")
+				if err := sess.relogin(ctx); err != nil {
+					log.Printf("relogin failed: %v", err)
+				}
+				return
+			}
+			log.Printf("poll failed: %v", err)
+		}
+	}
+
+	poll()
+	ticker := time.NewTicker(*interval)
+	go func() {
+		for range ticker.C {
+			poll()
+		}
+	}()
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		cache.WriteTo(w)
+	})
+
+	log.Printf("serving /metrics on %s every %s", *listen, *interval)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// pollOnce retrieves every HostSystem and Datastore under the root folder
+// and refreshes the metric cache from them.
+func pollOnce(ctx context.Context, sess *exporterSession, cache *metricCache) error {
+	m := view.NewManager(sess.c.Client)
+
+	clusterNames, err := clusterNamesByRef(ctx, sess.c, m)
+	if err != nil {
+		return err
+	}
+
+	hostView, err := m.CreateContainerView(ctx, sess.c.ServiceContent.RootFolder, []string{"HostSystem"}, true)
+	if err != nil {
+		return err
+	}
+	defer hostView.Destroy(ctx)
+
+	var hss []mo.HostSystem
+	if err := hostView.Retrieve(ctx, []string{"HostSystem"}, []string{"name", "parent", "summary"}, &hss); err != nil {
+		return err
+	}
+
+	for _, host := range hss {
+		cluster := ""
+		if host.Parent != nil {
+			cluster = clusterNames[host.Parent.Value]
+		}
+		cpu := cpuStats(host)
+		mem := memStats(host)
+		hostLabels := labels("host", host.Name, "cluster", cluster)
+		cache.set(sample{metric: "vmware_host_cpu_mhz_total", labels: hostLabels, value: cpu.total})
+		cache.set(sample{metric: "vmware_host_cpu_mhz_used", labels: hostLabels, value: cpu.total - cpu.free})
+		cache.set(sample{metric: "vmware_host_mem_bytes_total", labels: hostLabels, value: mem.total * 1024 * 1024})
+		cache.set(sample{metric: "vmware_host_mem_bytes_used", labels: hostLabels, value: (mem.total - mem.free) * 1024 * 1024})
+	}
+
+	dsView, err := m.CreateContainerView(ctx, sess.c.ServiceContent.RootFolder, []string{"Datastore"}, true)
+	if err != nil {
+		return err
+	}
+	defer dsView.Destroy(ctx)
+
+	var dss []mo.Datastore
+	if err := dsView.Retrieve(ctx, []string{"Datastore"}, []string{"name", "summary"}, &dss); err != nil {
+		return err
+	}
+
+	for _, ds := range dss {
+		store := datastoreStats(ds)
+		dsLabels := labels("datastore", store.name)
+		cache.set(sample{metric: "vmware_datastore_bytes_total", labels: dsLabels, value: store.total})
+		cache.set(sample{metric: "vmware_datastore_bytes_free", labels: dsLabels, value: store.free})
+	}
+
+	return nil
+}
+
+// clusterNamesByRef maps every ComputeResource's managed object reference
+// to its name, so hosts can be labeled with the cluster they belong to.
+func clusterNamesByRef(ctx context.Context, c *govmomi.Client, m *view.Manager) (map[string]string, error) {
+	v, err := m.CreateContainerView(ctx, c.ServiceContent.RootFolder, []string{"ComputeResource"}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer v.Destroy(ctx)
+
+	var crs []mo.ComputeResource
+	if err := v.Retrieve(ctx, []string{"ComputeResource"}, []string{"name"}, &crs); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(crs))
+	for _, cr := range crs {
+		names[cr.Self.Value] = cr.Name
+	}
+	return names, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []string
+		want  string
+	}{
+		{name: "single pair", pairs: []string{"host", "esx1"}, want: `host="esx1"`},
+		{
+			name:  "multiple pairs joined with comma",
+			pairs: []string{"host", "esx1", "cluster", "prod"},
+			want:  `host="esx1",cluster="prod"`,
+		},
+		{name: "no pairs", pairs: nil, want: ""},
+		{
+			name:  "value needing quote escaping",
+			pairs: []string{"datastore", `nfs-"prod"`},
+			want:  `datastore="nfs-\"prod\""`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := labels(c.pairs...); got != c.want {
+				t.Errorf("labels(%v) = %q, want %q", c.pairs, got, c.want)
+			}
+		})
+	}
+}
+
+func TestLabelsOddArgsPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("labels() with an odd number of arguments: want panic, got none")
+		}
+	}()
+	labels("host", "esx1", "cluster")
+}
+
+func TestMetricCacheWriteTo(t *testing.T) {
+	cache := &metricCache{}
+	cache.set(sample{metric: "vmware_host_cpu_mhz_total", labels: `host="esx2",cluster="prod"`, value: 8000})
+	cache.set(sample{metric: "vmware_host_cpu_mhz_total", labels: `host="esx1",cluster="prod"`, value: 4000})
+	cache.set(sample{metric: "vmware_datastore_bytes_free", labels: `datastore="ds1"`, value: 1024})
+
+	rec := httptest.NewRecorder()
+	cache.WriteTo(rec)
+
+	want := "# TYPE vmware_datastore_bytes_free gauge\n" +
+		`vmware_datastore_bytes_free{datastore="ds1"} 1024` + "\n" +
+		"# TYPE vmware_host_cpu_mhz_total gauge\n" +
+		`vmware_host_cpu_mhz_total{host="esx1",cluster="prod"} 4000` + "\n" +
+		`vmware_host_cpu_mhz_total{host="esx2",cluster="prod"} 8000` + "\n"
+
+	if got := rec.Body.String(); got != want {
+		t.Errorf("WriteTo() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestMetricCacheWriteToOverwritesSameKey(t *testing.T) {
+	cache := &metricCache{}
+	cache.set(sample{metric: "vmware_datastore_bytes_free", labels: `datastore="ds1"`, value: 1024})
+	cache.set(sample{metric: "vmware_datastore_bytes_free", labels: `datastore="ds1"`, value: 2048})
+
+	rec := httptest.NewRecorder()
+	cache.WriteTo(rec)
+
+	want := "# TYPE vmware_datastore_bytes_free gauge\n" +
+		`vmware_datastore_bytes_free{datastore="ds1"} 2048` + "\n"
+
+	if got := rec.Body.String(); got != want {
+		t.Errorf("WriteTo() = %q, want %q (second set() for the same key should replace, not duplicate)", got, want)
+	}
+}
+
+func TestIsNotAuthenticated(t *testing.T) {
+	if isNotAuthenticated(nil) {
+		t.Error("isNotAuthenticated(nil) = true, want false")
+	}
+	if isNotAuthenticated(errPlain("boom")) {
+		t.Error("isNotAuthenticated(non-SOAP error) = true, want false")
+	}
+}
+
+type errPlain string
+
+func (e errPlain) Error() string { return string(e) }
@@ -7,19 +7,39 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/view"
-	"github.com/vmware/govmomi/vim25/mo"
 )
 
+// Nagios plugin exit codes. See
+// https://nagios-plugins.org/doc/guidelines.html#AEN78
+const (
+	statusOK = iota
+	statusWarning
+	statusCritical
+	statusUnknown
+)
+
+var statusLabel = map[int]string{
+	statusOK:       "OK",
+	statusWarning:  "WARNING",
+	statusCritical: "CRITICAL",
+	statusUnknown:  "UNKNOWN",
+}
+
 var (
 	hostname, username, password, command, datastore string
+	match, exclude, aggregate                        string
 	warning                                          int
 	critical                                         int
+	verbose                                          bool
 )
 
+// resource holds the raw total/free figures retrieved for a single
+// HostSystem or Datastore, before they are turned into a CheckResult.
 type resource struct {
 	name string
 	statistics
@@ -30,22 +50,235 @@ type statistics struct {
 	free  float64
 }
 
-func (r *resource) freePer() string {
-	// return r.free / r.total * 100
-	return fmt.Sprintf("%.2f", (r.free / r.total * 100))
+// CheckResult is the evaluated form of a resource: everything needed to
+// render a Nagios-compatible status line without talking to vCenter
+// again, which keeps it unit-testable.
+type CheckResult struct {
+	Command string
+	Name    string
+	Total   float64
+	Free    float64
+	Unit    string
+	// Detail, if set, is appended after the free=X% summary, e.g. to
+	// surface a VM's power state or a cluster's DRS/HA status.
+	Detail string
+}
+
+// freePercent returns the free space/capacity as a percentage of total.
+func (c CheckResult) freePercent() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return c.Free / c.Total * 100
+}
+
+// Status compares the free percentage against warn/crit, both of which are
+// lower bounds on "free" (i.e. alert once free drops to or below them).
+func (c CheckResult) Status(warn, crit int) int {
+	if c.Total == 0 {
+		return statusUnknown
+	}
+	freePct := c.freePercent()
+	switch {
+	case freePct <= float64(crit):
+		return statusCritical
+	case freePct <= float64(warn):
+		return statusWarning
+	default:
+		return statusOK
+	}
+}
+
+// Perfdata renders this result's Nagios perfdata fields for warn/crit.
+func (c CheckResult) Perfdata(warn, crit int) string {
+	if c.Total == 0 {
+		return ""
+	}
+	used := c.Total - c.Free
+	return fmt.Sprintf("'free_pct'=%.2f%%;%d;%d;0;100 'used'=%.0f%s;;;0;%.0f",
+		c.freePercent(), warn, crit, used, c.Unit, c.Total)
+}
+
+// Summary renders this result's "<name> free=X%" fragment, including the
+// Detail note when set.
+func (c CheckResult) Summary() string {
+	if c.Total == 0 {
+		return fmt.Sprintf("%s has no capacity data", c.Name)
+	}
+	summary := fmt.Sprintf("%s free=%.2f%%", c.Name, c.freePercent())
+	if c.Detail != "" {
+		summary += " " + c.Detail
+	}
+	return summary
+}
+
+// Evaluate compares the free percentage against warn/crit, both of which
+// are lower bounds on "free" (i.e. alert once free drops to or below
+// them), and renders the Nagios plugin output line together with the
+// exit status to use.
+func (c CheckResult) Evaluate(warn, crit int) (status int, msg string) {
+	status = c.Status(warn, crit)
+	return status, statusLine(c.Command, status, c.Summary(), c.Perfdata(warn, crit))
+}
+
+// statusLine renders a Nagios plugin status line for checks whose result
+// isn't a free-percentage figure (e.g. age or boolean checks), keeping the
+// same "<Command> <STATUS> - <summary> | <perfdata>" shape as Evaluate.
+func statusLine(command string, status int, summary, perfdata string) string {
+	if perfdata == "" {
+		return fmt.Sprintf("%s %s - %s", command, statusLabel[status], summary)
+	}
+	return fmt.Sprintf("%s %s - %s | %s", command, statusLabel[status], summary, perfdata)
+}
+
+// severity ranks statuses from best to worst so the worst of several
+// results can be picked; Nagios treats CRITICAL as worse than WARNING,
+// which in turn is worse than UNKNOWN.
+func severity(status int) int {
+	switch status {
+	case statusCritical:
+		return 3
+	case statusWarning:
+		return 2
+	case statusUnknown:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// filterResources keeps results matching name exactly (when set), the
+// --match regex (when set) and not matching the --exclude regex (when set).
+func filterResources(results []CheckResult, name, match, exclude string) ([]CheckResult, error) {
+	var matchRe, excludeRe *regexp.Regexp
+	var err error
+	if match != "" {
+		if matchRe, err = regexp.Compile(match); err != nil {
+			return nil, fmt.Errorf("invalid --match regex: %w", err)
+		}
+	}
+	if exclude != "" {
+		if excludeRe, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid --exclude regex: %w", err)
+		}
+	}
+
+	var out []CheckResult
+	for _, r := range results {
+		if name != "" && r.Name != name {
+			continue
+		}
+		if matchRe != nil && !matchRe.MatchString(r.Name) {
+			continue
+		}
+		if excludeRe != nil && excludeRe.MatchString(r.Name) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// aggregateResults combines results into a single synthetic CheckResult
+// using mode (min, max, avg or sum) so a threshold can be applied across
+// every matching object at once instead of per-object.
+func aggregateResults(command string, results []CheckResult, mode string) (CheckResult, error) {
+	if mode == "sum" {
+		var total, free float64
+		for _, r := range results {
+			total += r.Total
+			free += r.Free
+		}
+		return CheckResult{
+			Command: command,
+			Name:    fmt.Sprintf("sum(%d matching)", len(results)),
+			Total:   total,
+			Free:    free,
+			Unit:    results[0].Unit,
+		}, nil
+	}
+
+	var pct float64
+	for i, r := range results {
+		p := r.freePercent()
+		switch mode {
+		case "avg":
+			pct += p
+		case "min":
+			if i == 0 || p < pct {
+				pct = p
+			}
+		case "max":
+			if i == 0 || p > pct {
+				pct = p
+			}
+		default:
+			return CheckResult{}, fmt.Errorf("unknown --aggregate mode %q, want one of min, max, avg, sum", mode)
+		}
+	}
+	if mode == "avg" {
+		pct /= float64(len(results))
+	}
+
+	return CheckResult{
+		Command: command,
+		Name:    fmt.Sprintf("%s(%d matching)", mode, len(results)),
+		Total:   100,
+		Free:    pct,
+		Unit:    "%",
+	}, nil
+}
+
+// evaluateWorst evaluates every result against warn/crit independently and
+// reports the worst status found, with a summary naming every offender
+// (any result that isn't OK) and every result's perfdata concatenated.
+func evaluateWorst(command string, results []CheckResult, warn, crit int) (int, string) {
+	worstStatus := statusOK
+	var offenders []string
+	var perfdata []string
+
+	for _, r := range results {
+		status := r.Status(warn, crit)
+		if perf := r.Perfdata(warn, crit); perf != "" {
+			perfdata = append(perfdata, perf)
+		}
+		if status != statusOK {
+			offenders = append(offenders, fmt.Sprintf("%s (%s)", r.Name, statusLabel[status]))
+		}
+		if severity(status) > severity(worstStatus) {
+			worstStatus = status
+		}
+	}
+
+	summary := fmt.Sprintf("%d/%d checked", len(results)-len(offenders), len(results))
+	if len(offenders) > 0 {
+		summary += fmt.Sprintf(", offenders: %s", strings.Join(offenders, ", "))
+	}
+
+	return worstStatus, statusLine(command, worstStatus, summary, strings.Join(perfdata, " "))
 }
 
 func init() {
 	pflag.StringVarP(&hostname, "hostname", "h", "", "ESXi hostname to query")
 	pflag.StringVarP(&username, "username", "u", "", "Username to connect with.")
 	pflag.StringVarP(&password, "password", "p", "", "Password to use with the username.")
-	pflag.StringVarP(&command, "command", "l", "", "Specify command type (CPU, MEM, VMFS)")
-	pflag.StringVarP(&datastore, "datastore", "s", "", "Storage name")
-	pflag.IntVarP(&warning, "warning", "w", 85, "Warning Threshold")
-	pflag.IntVarP(&critical, "critical", "c", 90, "Critical Threshold")
+	pflag.StringVarP(&command, "command", "l", "", "Specify command type (see --command list for choices)")
+	pflag.StringVarP(&datastore, "datastore", "s", "", "Object name: datastore/VM/host name required by VM_SNAPSHOT, DS_IOPS and NET, or an exact-match filter for other commands")
+	pflag.IntVarP(&warning, "warning", "w", 15, "Warning threshold, as a lower bound on free %")
+	pflag.IntVarP(&critical, "critical", "c", 10, "Critical threshold, as a lower bound on free %")
+	pflag.BoolVarP(&verbose, "verbose", "v", false, "Print debug traces in addition to the Nagios status line")
+	pflag.StringVar(&match, "match", "", "Only check objects whose name matches this regex")
+	pflag.StringVar(&exclude, "exclude", "", "Skip objects whose name matches this regex")
+	pflag.StringVar(&aggregate, "aggregate", "", "Combine all matching objects with min, max, avg or sum instead of reporting each one")
 }
 
-func getKeys(k map[string]string) []string {
+func debugf(format string, args ...interface{}) {
+	if verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
+func getKeys(k map[string]Checker) []string {
 	keys := make([]string, 0, len(k))
 	for k := range k {
 		keys = append(keys, k)
@@ -55,7 +288,7 @@ func getKeys(k map[string]string) []string {
 
 func urlCheck(h string) string {
 	matched, _ := regexp.MatchString("^.*://.*$", h)
-	fmt.Println(matched)
+	debugf("%v\n", matched)
 	if !matched {
 		return fmt.Sprintf("https://%s/sdk", h)
 	}
@@ -63,35 +296,56 @@ func urlCheck(h string) string {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "exporter" {
+		runExporter(os.Args[2:])
+		return
+	}
+
 	pflag.Parse()
+	if err := applyLayeredConfig(); err != nil {
+		log.Fatal(err)
+	}
 	err := checkRequiredOptions()
 	if err != nil {
 		pflag.Usage()
 		log.Fatal(err)
 	}
-	commandChoices := map[string]string{"MEM": "HostSystem", "CPU": "HostSystem", "VMFS": "Datastore"}
-	if _, validChoice := commandChoices[command]; !validChoice {
-		fmt.Printf("valid choices %v\n", getKeys(commandChoices))
-		//fmt.Println(getKeys(commandChoices))
-		//pflag.Usage()
-		os.Exit(2)
+
+	checker, validChoice := checkers[command]
+	if !validChoice {
+		fmt.Printf("valid choices %v\n", getKeys(checkers))
+		os.Exit(statusUnknown)
 	}
 
-	if command == "VMFS" && datastore == "" {
-		fmt.Printf("pass storage name for %s option using (-s | --datastore)\n", command)
+	single, isSingleObject := checker.(SingleObjectChecker)
+
+	if isSingleObject && datastore == "" {
+		fmt.Printf("pass the object name for %s option using (-s | --datastore)\n", command)
 		pflag.Usage()
-		os.Exit(2)
+		os.Exit(statusUnknown)
+	}
+	if isSingleObject && (match != "" || exclude != "" || aggregate != "") {
+		fmt.Printf("--match/--exclude/--aggregate are not supported by the %s command\n", command)
+		os.Exit(statusUnknown)
+	}
+	if aggregate != "" {
+		switch aggregate {
+		case "min", "max", "avg", "sum":
+		default:
+			fmt.Printf("--aggregate must be one of min, max, avg, sum, got %q\n", aggregate)
+			os.Exit(statusUnknown)
+		}
 	}
 
-	fmt.Println(hostname, username, password, command, warning, critical, datastore)
-	fmt.Println(urlCheck(hostname))
+	debugf("%s %s %s %s %d %d %s\n", hostname, username, password, command, warning, critical, datastore)
+	debugf("%s\n", urlCheck(hostname))
 
 	ctx := context.Background()
 	u, _ := url.Parse(urlCheck(hostname))
 
 	u.User = url.UserPassword(username, password)
 
-	fmt.Println(u.String())
+	debugf("%s\n", u.String())
 
 	c, err := govmomi.NewClient(ctx, u, true)
 	if err != nil {
@@ -100,87 +354,64 @@ func main() {
 
 	m := view.NewManager(c.Client)
 
-	v, err := m.CreateContainerView(ctx, c.ServiceContent.RootFolder, []string{commandChoices[command]}, true)
-	//v, err := m.CreateContainerView(ctx, c.ServiceContent.RootFolder, []string{"HostSystem"}, true)
+	v, err := m.CreateContainerView(ctx, c.ServiceContent.RootFolder, []string{checker.ObjectType()}, true)
 	if err != nil {
 		log.Fatal(err)
 	}
-
 	defer v.Destroy(ctx)
 
-	var hss []mo.HostSystem
-	var ds []mo.Datastore
+	var status int
+	var msg string
 
-	e := &resource{}
-
-	if command == "VMFS" {
-		err = v.Retrieve(ctx, []string{commandChoices[command]}, []string{"name", "summary"}, &ds)
+	if isSingleObject {
+		status, msg, err = single.Run(ctx, c, v, datastore, warning, critical)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		for _, host := range ds {
-			fmt.Println(host.Name)
-			if datastore == host.Name {
-				e = datastoreStats(host)
-				break
-			}
-		}
-		if e.name == "" {
-			fmt.Printf("No datastore with name %s found.\n", datastore)
-			os.Exit(1)
+	} else {
+		resourceChecker := checker.(ResourceChecker)
+		results, err := resourceChecker.Resources(ctx, c, v)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-	} else {
-		err = v.Retrieve(ctx, []string{commandChoices[command]}, []string{"name", "summary"}, &hss)
+		filtered, err := filterResources(results, datastore, match, exclude)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if len(filtered) == 0 {
+			fmt.Println(statusLine(command, statusUnknown, "no matching object found", ""))
+			os.Exit(statusUnknown)
+		}
 
-		for _, host := range hss {
-			fmt.Println(host.Name)
-			switch command {
-			case "CPU":
-				e = cpuStats(host)
-			case "MEM":
-				e = memStats(host)
+		if aggregate != "" {
+			agg, err := aggregateResults(command, filtered, aggregate)
+			if err != nil {
+				log.Fatal(err)
 			}
+			status, msg = agg.Evaluate(warning, critical)
+		} else {
+			status, msg = evaluateWorst(command, filtered, warning, critical)
 		}
 	}
 
-	fmt.Println(e.name)
-	fmt.Printf("total  %f \n free %f \n remaining %s\n", e.total, e.free, e.freePer())
-
+	fmt.Println(msg)
+	os.Exit(status)
 }
 
-func datastoreStats(ds mo.Datastore) *resource {
-	return (&resource{
-		name: ds.Summary.Name,
-		statistics: statistics{
-			total: float64(ds.Summary.Capacity),
-			free:  float64(ds.Summary.FreeSpace),
-		},
-	})
-}
-
-func cpuStats(host mo.HostSystem) *resource {
-	return (&resource{
-		name: host.Name,
-		statistics: statistics{
-			total: float64(host.Summary.Hardware.CpuMhz) * float64(host.Summary.Hardware.NumCpuCores),
-			free:  (float64(host.Summary.Hardware.CpuMhz) * float64(host.Summary.Hardware.NumCpuCores)) - float64(host.Summary.QuickStats.OverallCpuUsage),
-		},
-	})
-}
-
-func memStats(host mo.HostSystem) *resource {
-	return (&resource{
-		name: host.Name,
-		statistics: statistics{
-			total: float64(host.Summary.Hardware.MemorySize) / 1024 / 1024,
-			free:  (float64(host.Summary.Hardware.MemorySize) / 1024 / 1024) - float64(host.Summary.QuickStats.OverallMemoryUsage),
-		},
-	})
+// resultUnit returns the perfdata unit of measure for a command's
+// total/used figures.
+func resultUnit(command string) string {
+	switch command {
+	case "VMFS":
+		return "B"
+	case "CPU":
+		return "MHz"
+	case "MEM":
+		return "MB"
+	default:
+		return ""
+	}
 }
 
 func checkRequiredOptions() error {
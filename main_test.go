@@ -0,0 +1,197 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckResultEvaluate(t *testing.T) {
+	cases := []struct {
+		name       string
+		result     CheckResult
+		wantStatus int
+	}{
+		{
+			name:       "plenty free is OK",
+			result:     CheckResult{Command: "VMFS", Name: "datastore1", Total: 100, Free: 42.15, Unit: "B"},
+			wantStatus: statusOK,
+		},
+		{
+			name:       "free at warning threshold",
+			result:     CheckResult{Command: "VMFS", Name: "datastore1", Total: 100, Free: 15, Unit: "B"},
+			wantStatus: statusWarning,
+		},
+		{
+			name:       "free at critical threshold",
+			result:     CheckResult{Command: "VMFS", Name: "datastore1", Total: 100, Free: 10, Unit: "B"},
+			wantStatus: statusCritical,
+		},
+		{
+			name:       "no capacity data is unknown",
+			result:     CheckResult{Command: "VMFS", Name: "datastore1"},
+			wantStatus: statusUnknown,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, msg := c.result.Evaluate(15, 10)
+			if status != c.wantStatus {
+				t.Errorf("Evaluate() status = %d, want %d (msg=%q)", status, c.wantStatus, msg)
+			}
+			if !strings.HasPrefix(msg, c.result.Command+" "+statusLabel[c.wantStatus]) {
+				t.Errorf("Evaluate() msg = %q, want prefix %q", msg, c.result.Command+" "+statusLabel[c.wantStatus])
+			}
+		})
+	}
+}
+
+func TestCheckersRegistryObjectTypes(t *testing.T) {
+	want := map[string]string{
+		"CPU":         "HostSystem",
+		"MEM":         "HostSystem",
+		"VMFS":        "Datastore",
+		"VM":          "VirtualMachine",
+		"VM_SNAPSHOT": "VirtualMachine",
+		"DS_IOPS":     "Datastore",
+		"CLUSTER":     "ClusterComputeResource",
+		"NET":         "HostSystem",
+	}
+
+	if len(checkers) != len(want) {
+		t.Fatalf("len(checkers) = %d, want %d", len(checkers), len(want))
+	}
+
+	for command, objectType := range want {
+		checker, ok := checkers[command]
+		if !ok {
+			t.Errorf("checkers[%q] missing", command)
+			continue
+		}
+		if got := checker.ObjectType(); got != objectType {
+			t.Errorf("checkers[%q].ObjectType() = %q, want %q", command, got, objectType)
+		}
+	}
+}
+
+func TestCheckResultEvaluatePerfdata(t *testing.T) {
+	result := CheckResult{Command: "VMFS", Name: "datastore1", Total: 789012, Free: 332448.0, Unit: "B"}
+	_, msg := result.Evaluate(15, 10)
+
+	want := "'free_pct'=42.13%;15;10;0;100 'used'=456564B;;;0;789012"
+	if !strings.Contains(msg, want) {
+		t.Errorf("Evaluate() msg = %q, want it to contain %q", msg, want)
+	}
+}
+
+func TestFilterResources(t *testing.T) {
+	results := []CheckResult{
+		{Name: "datastore1"},
+		{Name: "nfs-prod"},
+		{Name: "nfs-test"},
+		{Name: "ssd-scratch"},
+	}
+
+	cases := []struct {
+		name           string
+		objName        string
+		match, exclude string
+		wantNames      []string
+	}{
+		{name: "exact name", objName: "nfs-prod", wantNames: []string{"nfs-prod"}},
+		{name: "match regex", match: "^nfs-", wantNames: []string{"nfs-prod", "nfs-test"}},
+		{name: "exclude regex", exclude: "^nfs-", wantNames: []string{"datastore1", "ssd-scratch"}},
+		{name: "match and exclude combined", match: "^nfs-", exclude: "test$", wantNames: []string{"nfs-prod"}},
+		{name: "no filters keeps everything", wantNames: []string{"datastore1", "nfs-prod", "nfs-test", "ssd-scratch"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := filterResources(results, c.objName, c.match, c.exclude)
+			if err != nil {
+				t.Fatalf("filterResources() error = %v", err)
+			}
+			var gotNames []string
+			for _, r := range got {
+				gotNames = append(gotNames, r.Name)
+			}
+			if !reflect.DeepEqual(gotNames, c.wantNames) {
+				t.Errorf("filterResources() names = %v, want %v", gotNames, c.wantNames)
+			}
+		})
+	}
+}
+
+func TestFilterResourcesInvalidRegex(t *testing.T) {
+	if _, err := filterResources(nil, "", "(", ""); err == nil {
+		t.Error("filterResources() with invalid --match regex: want error, got nil")
+	}
+	if _, err := filterResources(nil, "", "", "("); err == nil {
+		t.Error("filterResources() with invalid --exclude regex: want error, got nil")
+	}
+}
+
+func TestAggregateResults(t *testing.T) {
+	results := []CheckResult{
+		{Total: 100, Free: 10, Unit: "B"},
+		{Total: 100, Free: 30, Unit: "B"},
+		{Total: 100, Free: 50, Unit: "B"},
+	}
+
+	cases := []struct {
+		mode     string
+		wantFree float64
+	}{
+		{mode: "min", wantFree: 10},
+		{mode: "max", wantFree: 50},
+		{mode: "avg", wantFree: 30},
+	}
+
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			agg, err := aggregateResults("VMFS", results, c.mode)
+			if err != nil {
+				t.Fatalf("aggregateResults() error = %v", err)
+			}
+			if agg.freePercent() != c.wantFree {
+				t.Errorf("aggregateResults(%q) free%% = %v, want %v", c.mode, agg.freePercent(), c.wantFree)
+			}
+		})
+	}
+
+	t.Run("sum", func(t *testing.T) {
+		agg, err := aggregateResults("VMFS", results, "sum")
+		if err != nil {
+			t.Fatalf("aggregateResults() error = %v", err)
+		}
+		if agg.Total != 300 || agg.Free != 90 {
+			t.Errorf("aggregateResults(%q) = {Total: %v, Free: %v}, want {300, 90}", "sum", agg.Total, agg.Free)
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		if _, err := aggregateResults("VMFS", results, "median"); err == nil {
+			t.Error("aggregateResults() with unknown mode: want error, got nil")
+		}
+	})
+}
+
+func TestEvaluateWorst(t *testing.T) {
+	results := []CheckResult{
+		{Name: "datastore1", Total: 100, Free: 50, Unit: "B"},
+		{Name: "datastore2", Total: 100, Free: 12, Unit: "B"},
+		{Name: "datastore3", Total: 100, Free: 5, Unit: "B"},
+	}
+
+	status, msg := evaluateWorst("VMFS", results, 15, 10)
+	if status != statusCritical {
+		t.Errorf("evaluateWorst() status = %d, want %d (msg=%q)", status, statusCritical, msg)
+	}
+	if !strings.Contains(msg, "datastore2 (WARNING)") || !strings.Contains(msg, "datastore3 (CRITICAL)") {
+		t.Errorf("evaluateWorst() msg = %q, want offenders datastore2 and datastore3 named", msg)
+	}
+	if strings.Contains(msg, "datastore1 (") {
+		t.Errorf("evaluateWorst() msg = %q, want datastore1 not listed as an offender", msg)
+	}
+}